@@ -33,7 +33,8 @@ type Call struct {
 	rets       []interface{} // the return values (if any)
 	origin     string        // file and line number of call setup
 
-	preReqs []*Call // prerequisite calls
+	preReq prereqNode // prerequisite expression; nil if this call has none
+	cond   prereqNode // for composite calls (AnyOrder, OneOf), the condition defining satisfied()
 
 	// Expectations
 	minCalls, maxCalls int
@@ -41,8 +42,11 @@ type Call struct {
 	numCalls int // actual number made
 
 	// Actions
-	doFunc  reflect.Value
-	setArgs map[int]reflect.Value
+	doFunc       reflect.Value
+	doReturnFunc reflect.Value
+	setArgs      map[int]reflect.Value
+
+	recorder *Recorder // non-nil if this call's setup and invocations should be recorded
 }
 
 // AnyTimes allows the expectation to be called 0 or more times
@@ -79,6 +83,43 @@ func (c *Call) Do(f interface{}) *Call {
 	return c
 }
 
+// DoAndReturn declares the action to run when the call is matched. The
+// return values from this function are returned by the mocked function.
+// It takes an interface{} argument to support n-arity functions.
+func (c *Call) DoAndReturn(f interface{}) *Call {
+	v := reflect.ValueOf(f)
+
+	mt := c.methodType
+	ft := v.Type()
+	if c.methodType.NumIn() != ft.NumIn() {
+		c.t.Fatalf("wrong number of arguments in DoAndReturn func for %T.%v: got %d, want %d [%s]\n%s",
+			c.receiver, c.method, ft.NumIn(), mt.NumIn(), c.origin, debug.Stack())
+		return c
+	}
+	if c.methodType.NumOut() != ft.NumOut() {
+		c.t.Fatalf("wrong number of return values in DoAndReturn func for %T.%v: got %d, want %d [%s]\n%s",
+			c.receiver, c.method, ft.NumOut(), mt.NumOut(), c.origin, debug.Stack())
+		return c
+	}
+	for i := 0; i < ft.NumIn(); i++ {
+		if in := mt.In(i); !in.AssignableTo(ft.In(i)) && !ft.In(i).AssignableTo(in) {
+			c.t.Fatalf("wrong type of argument %d in DoAndReturn func for %T.%v: %v is not assignable to %v [%s]\n%s",
+				i, c.receiver, c.method, in, ft.In(i), c.origin, debug.Stack())
+			return c
+		}
+	}
+	for i := 0; i < ft.NumOut(); i++ {
+		if out := mt.Out(i); !ft.Out(i).AssignableTo(out) {
+			c.t.Fatalf("wrong type of return value %d in DoAndReturn func for %T.%v: %v is not assignable to %v [%s]\n%s",
+				i, c.receiver, c.method, ft.Out(i), out, c.origin, debug.Stack())
+			return c
+		}
+	}
+
+	c.doReturnFunc = v
+	return c
+}
+
 func (c *Call) Return(rets ...interface{}) *Call {
 	mt := c.methodType
 	if len(rets) != mt.NumOut() {
@@ -125,15 +166,26 @@ func (c *Call) SetArg(n int, value interface{}) *Call {
 		c.setArgs = make(map[int]reflect.Value)
 	}
 	mt := c.methodType
-	// TODO: This will break on variadic methods.
-	// We will need to check those at invocation time.
-	if n < 0 || n >= mt.NumIn() {
+	// The final declared parameter of a variadic method stands in for any
+	// number of actual arguments at call time, so n may legitimately exceed
+	// mt.NumIn()-1; check it against the slice's element type instead.
+	variadic := mt.IsVariadic() && n >= mt.NumIn()-1
+	if !variadic && (n < 0 || n >= mt.NumIn()) {
+		c.t.Fatalf("SetArg(%d, ...) called for a method with %d args [%s]\n%s",
+			n, mt.NumIn(), c.origin, debug.Stack())
+	}
+	if variadic && n < 0 {
 		c.t.Fatalf("SetArg(%d, ...) called for a method with %d args [%s]\n%s",
 			n, mt.NumIn(), c.origin, debug.Stack())
 	}
 	// Permit setting argument through an interface.
 	// In the interface case, we don't (nay, can't) check the type here.
-	at := mt.In(n)
+	var at reflect.Type
+	if variadic {
+		at = mt.In(mt.NumIn() - 1).Elem()
+	} else {
+		at = mt.In(n)
+	}
 	switch at.Kind() {
 	case reflect.Ptr:
 		dt := at.Elem()
@@ -151,11 +203,18 @@ func (c *Call) SetArg(n int, value interface{}) *Call {
 	return c
 }
 
-// isPreReq returns true if other is a direct or indirect prerequisite to c.
+// isPreReq returns true if other is a direct or indirect prerequisite to c,
+// whether reached through an explicit After chain or through the condition
+// of a composite call (AnyOrder, OneOf) along the way, c itself included.
 func (c *Call) isPreReq(other *Call) bool {
-	for _, preReq := range c.preReqs {
-		if other == preReq || preReq.isPreReq(other) {
-			return true
+	for _, node := range []prereqNode{c.preReq, c.cond} {
+		if node == nil {
+			continue
+		}
+		for _, call := range node.calls() {
+			if call == other || call.isPreReq(other) {
+				return true
+			}
 		}
 	}
 	return false
@@ -170,12 +229,15 @@ func (c *Call) After(preReq *Call) *Call {
 		c.t.Fatalf("Loop in call order: %v is a prerequisite to %v (possibly indirectly).", c, preReq)
 	}
 
-	c.preReqs = append(c.preReqs, preReq)
+	c.preReq = andOf(c.preReq, callNode{preReq})
 	return c
 }
 
 // Returns true if the minimum number of calls have been made.
 func (c *Call) satisfied() bool {
+	if c.cond != nil {
+		return c.cond.satisfied()
+	}
 	return c.numCalls >= c.minCalls
 }
 
@@ -185,6 +247,9 @@ func (c *Call) exhausted() bool {
 }
 
 func (c *Call) String() string {
+	if c.cond != nil {
+		return c.cond.String()
+	}
 	args := make([]string, len(c.args))
 	for i, arg := range c.args {
 		args[i] = arg.String()
@@ -196,22 +261,69 @@ func (c *Call) String() string {
 // Tests if the given call matches the expected call.
 // If yes, returns nil. If no, returns error with message explaining why it does not match.
 func (c *Call) matches(args []interface{}) error {
-	if len(args) != len(c.args) {
-		return fmt.Errorf("Invalid number of arguments of call: %s. Set: %s, while this call takes: %s",
-			c.origin, strconv.Itoa(len(args)), strconv.Itoa(len(c.args)))
-	}
-	for i, m := range c.args {
-		if !m.Matches(args[i]) {
-			return fmt.Errorf("The expected argument of index: %s of this call: %s did not match the actual argument.\nActual argument: %s, expected: %v\n",
-				strconv.Itoa(i), c.origin, m, args[i])
+	if !c.methodType.IsVariadic() {
+		if len(args) != len(c.args) {
+			return fmt.Errorf("Invalid number of arguments of call: %s. Set: %s, while this call takes: %s",
+				c.origin, strconv.Itoa(len(args)), strconv.Itoa(len(c.args)))
+		}
+		for i, m := range c.args {
+			if !m.Matches(args[i]) {
+				return fmt.Errorf("The expected argument of index: %s of this call: %s did not match the actual argument.\nActual argument: %s, expected: %v\n",
+					strconv.Itoa(i), c.origin, m, args[i])
+			}
+		}
+	} else {
+		// The final matcher may either cover the whole variadic tail as a
+		// single slice matcher (e.g. gomock.Eq([]int{1, 2})), or there may
+		// be one matcher per trailing actual argument. Both styles are
+		// supported, but only the last matcher is ever tried against the
+		// tail as a whole: trying it at every variadic position would let
+		// an early matcher that's trivially slice-compatible (gomock.Any(),
+		// for instance) short-circuit before later per-element matchers
+		// are ever checked.
+		fixed := c.methodType.NumIn() - 1
+		if len(c.args) < fixed {
+			return fmt.Errorf("Invalid number of matchers of call: %s. Set: %s, while this call takes at least: %s",
+				c.origin, strconv.Itoa(len(c.args)), strconv.Itoa(fixed))
+		}
+		if len(c.args) != c.methodType.NumIn() && len(c.args) != len(args) {
+			return fmt.Errorf("Invalid number of matchers of call: %s. Set: %s, while this call was invoked with: %s",
+				c.origin, strconv.Itoa(len(c.args)), strconv.Itoa(len(args)))
+		}
+		for i, m := range c.args {
+			if i < fixed {
+				if i >= len(args) {
+					return fmt.Errorf("Invalid number of arguments of call: %s. Set: %s, while this call takes: %s",
+						c.origin, strconv.Itoa(len(args)), strconv.Itoa(len(c.args)))
+				}
+				if !m.Matches(args[i]) {
+					return fmt.Errorf("The expected argument of index: %s of this call: %s did not match the actual argument.\nActual argument: %s, expected: %v\n",
+						strconv.Itoa(i), c.origin, m, args[i])
+				}
+				continue
+			}
+			// Only the last matcher may cover the remaining args as a
+			// whole slice; args[i:] is still valid (and meaningful, for an
+			// expectation of zero trailing args) when i == len(args).
+			if i == len(c.args)-1 && i <= len(args) && m.Matches(args[i:]) {
+				break
+			}
+			// Otherwise this is the per-element style, which needs exactly
+			// one matcher per actual argument.
+			if len(c.args) != len(args) {
+				return fmt.Errorf("Invalid number of arguments of call: %s. Set: %s, while this call takes: %s",
+					c.origin, strconv.Itoa(len(args)), strconv.Itoa(len(c.args)))
+			}
+			if !m.Matches(args[i]) {
+				return fmt.Errorf("The expected argument of index: %s of this call: %s did not match the actual argument.\nActual argument: %s, expected: %v\n",
+					strconv.Itoa(i), c.origin, m, args[i])
+			}
 		}
 	}
 
-	// Check that all prerequisite calls have been satisfied.
-	for _, preReqCall := range c.preReqs {
-		if !preReqCall.satisfied() {
-			return fmt.Errorf("A prerequisite call was not satisfied:\n%v\nshould be called before:\n%v", preReqCall, c)
-		}
+	// Check that the prerequisite expression, if any, has been satisfied.
+	if c.preReq != nil && !c.preReq.satisfied() {
+		return fmt.Errorf("A prerequisite call was not satisfied:\n%v\nshould be called before:\n%v", c.preReq, c)
 	}
 
 	return nil
@@ -220,29 +332,61 @@ func (c *Call) matches(args []interface{}) error {
 // dropPrereqs tells the expected Call to not re-check prerequisite calls any
 // longer, and to return its current set.
 func (c *Call) dropPrereqs() (preReqs []*Call) {
-	preReqs = c.preReqs
-	c.preReqs = nil
+	if c.preReq != nil {
+		preReqs = c.preReq.calls()
+	}
+	c.preReq = nil
 	return
 }
 
-func (c *Call) call(args []interface{}) (rets []interface{}, action func()) {
+// call computes the expectation's static return values and, if Do or
+// DoAndReturn was used, an action to run them. rets is ready to use as soon
+// as call returns; action, if non-nil, must be invoked by the caller before
+// the real return values are final - the same way a Do callback was already
+// deferred, DoAndReturn's func now only runs when action is invoked, so a
+// caller that defers action until after releasing its own lock (the way a
+// Controller invokes it post-unlock to avoid deadlocking on a callback that
+// calls back into the controller) gets that same protection for
+// DoAndReturn. If action returns a non-nil rets, it supersedes the rets
+// already returned by call.
+func (c *Call) call(args []interface{}) (rets []interface{}, action func() []interface{}) {
 	c.numCalls++
 
-	// Actions
-	if c.doFunc.IsValid() {
-		doArgs := make([]reflect.Value, len(args))
-		ft := c.doFunc.Type()
-		for i := 0; i < len(args); i++ {
-			if args[i] != nil {
-				doArgs[i] = reflect.ValueOf(args[i])
-			} else {
-				// Use the zero value for the arg.
-				doArgs[i] = reflect.Zero(ft.In(i))
+	if c.doFunc.IsValid() || c.doReturnFunc.IsValid() {
+		action = func() []interface{} {
+			if c.doFunc.IsValid() {
+				doArgs := callArgsAsValues(c.doFunc.Type(), args)
+				c.doFunc.Call(doArgs)
+			}
+			var doRets []interface{}
+			if c.doReturnFunc.IsValid() {
+				doArgs := callArgsAsValues(c.doReturnFunc.Type(), args)
+				retVals := c.doReturnFunc.Call(doArgs)
+				doRets = make([]interface{}, len(retVals))
+				for i, v := range retVals {
+					doRets[i] = v.Interface()
+				}
 			}
+			if c.recorder != nil {
+				final := doRets
+				if final == nil {
+					final = rets
+				}
+				c.recorder.recordInvocation(c, args, final)
+			}
+			return doRets
 		}
-		action = func() { c.doFunc.Call(doArgs) }
 	}
+
 	for n, v := range c.setArgs {
+		// For a variadic method, n was only checked against the declared
+		// signature at setup time; the actual arg count varies per call, so
+		// it must be checked again here before indexing args.
+		if n >= len(args) {
+			c.t.Fatalf("SetArg(%d, ...) called for %T.%v, which was invoked with only %d args [%s]",
+				n, c.receiver, c.method, len(args), c.origin)
+			continue
+		}
 		reflect.ValueOf(args[n]).Elem().Set(v)
 	}
 
@@ -256,9 +400,35 @@ func (c *Call) call(args []interface{}) (rets []interface{}, action func()) {
 		}
 	}
 
+	if action == nil && c.recorder != nil {
+		c.recorder.recordInvocation(c, args, rets)
+	}
+
 	return
 }
 
+// callArgsAsValues converts the actual call args into reflect.Values
+// suitable for invoking a function of type ft, substituting the zero
+// value of the corresponding parameter type for any nil argument.
+func callArgsAsValues(ft reflect.Type, args []interface{}) []reflect.Value {
+	vals := make([]reflect.Value, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] != nil {
+			vals[i] = reflect.ValueOf(args[i])
+			continue
+		}
+		// Use the zero value for the arg. Past the last declared parameter
+		// of a variadic func, every arg shares the variadic slot's element
+		// type rather than ft.In(i), which isn't defined there.
+		if ft.IsVariadic() && i >= ft.NumIn()-1 {
+			vals[i] = reflect.Zero(ft.In(ft.NumIn() - 1).Elem())
+		} else {
+			vals[i] = reflect.Zero(ft.In(i))
+		}
+	}
+	return vals
+}
+
 // InOrder declares that the given calls should occur in order.
 func InOrder(calls ...*Call) {
 	for i := 1; i < len(calls); i++ {
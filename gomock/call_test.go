@@ -0,0 +1,180 @@
+// Copyright 2010 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomock
+
+import (
+	"reflect"
+	"testing"
+)
+
+// variadicPrinter stands in for a mocked interface with a method shaped
+// like func(fmt string, args ...interface{}), used to build a Call's
+// methodType the way generated mock code would.
+type variadicPrinter interface {
+	Printf(format string, args ...interface{})
+}
+
+var printfMethodType = reflect.TypeOf((*variadicPrinter)(nil)).Elem().Method(0).Type
+
+func newPrintfCall(t *testing.T, args []Matcher) *Call {
+	return &Call{
+		t:          t,
+		receiver:   "printer",
+		method:     "Printf",
+		methodType: printfMethodType,
+		args:       args,
+	}
+}
+
+func TestCallMatchesVariadicZeroTrailingArgs(t *testing.T) {
+	c := newPrintfCall(t, []Matcher{Eq("fmt"), Eq([]interface{}{})})
+	if err := c.matches([]interface{}{"fmt"}); err != nil {
+		t.Fatalf("matches returned an error for a zero-trailing-arg variadic call: %v", err)
+	}
+}
+
+func TestCallMatchesVariadicSliceStyle(t *testing.T) {
+	c := newPrintfCall(t, []Matcher{Eq("fmt"), Eq([]interface{}{1, 2, 3})})
+	if err := c.matches([]interface{}{"fmt", 1, 2, 3}); err != nil {
+		t.Fatalf("matches returned an error for a slice-style variadic match: %v", err)
+	}
+}
+
+func TestCallMatchesVariadicPerElementStyle(t *testing.T) {
+	c := newPrintfCall(t, []Matcher{Eq("fmt"), Eq(1), Eq(2)})
+	if err := c.matches([]interface{}{"fmt", 1, 2}); err != nil {
+		t.Fatalf("matches returned an error for a per-element variadic match: %v", err)
+	}
+}
+
+// TestCallMatchesVariadicPerElementDisambiguation guards against a middle
+// per-element matcher (one that also happens to match the remaining tail
+// as a whole slice, like Any()) short-circuiting the match before later
+// matchers are checked.
+func TestCallMatchesVariadicPerElementDisambiguation(t *testing.T) {
+	c := newPrintfCall(t, []Matcher{Eq("fmt"), Any(), Eq(5)})
+	if err := c.matches([]interface{}{"fmt", 1, 6}); err == nil {
+		t.Fatalf("matches should have rejected trailing arg 6 against expected 5")
+	}
+	if err := c.matches([]interface{}{"fmt", 1, 5}); err != nil {
+		t.Fatalf("matches returned an error for a call that should have matched: %v", err)
+	}
+}
+
+func TestSetArgVariadic(t *testing.T) {
+	c := newPrintfCall(t, []Matcher{Any(), Any(), Any()})
+	c.SetArg(2, "patched")
+
+	var out string
+	c.call([]interface{}{"fmt", 1, &out})
+	if out != "patched" {
+		t.Fatalf("SetArg on a variadic slot did not set the value: got %q", out)
+	}
+}
+
+// recordingT is a TestReporter that records Fatalf calls instead of
+// aborting the goroutine, for tests that need to observe a failure that
+// call() is expected to report rather than panic on.
+type recordingT struct {
+	failed *bool
+}
+
+func (r recordingT) Fatalf(format string, args ...interface{}) { *r.failed = true }
+
+// TestSetArgVariadicShortCall guards against SetArg on a variadic slot
+// indexing past the actual argument count: a valid-at-setup-time index can
+// still exceed len(args) for a particular invocation that passed fewer
+// variadic args, and call() must fail through TestReporter rather than
+// panic with an index out of range.
+func TestSetArgVariadicShortCall(t *testing.T) {
+	var failed bool
+	c := &Call{
+		t:          recordingT{&failed},
+		receiver:   "printer",
+		method:     "Printf",
+		methodType: printfMethodType,
+		args:       []Matcher{Any(), Any()},
+	}
+	c.SetArg(1, "patched")
+
+	c.call([]interface{}{"fmt"})
+	if !failed {
+		t.Fatalf("call did not report a failure for SetArg on an argument beyond the actual call")
+	}
+}
+
+// adderMethodType stands in for a mocked interface with a method shaped
+// like func(int) int, used to exercise DoAndReturn's action deferral.
+type adder interface {
+	Add(n int) int
+}
+
+var addMethodType = reflect.TypeOf((*adder)(nil)).Elem().Method(0).Type
+
+func newAddCall(t *testing.T) *Call {
+	return &Call{
+		t:          t,
+		receiver:   "adder",
+		method:     "Add",
+		methodType: addMethodType,
+		args:       []Matcher{Any()},
+		rets:       []interface{}{0},
+	}
+}
+
+// TestDoAndReturnIsDeferredToAction guards against DoAndReturn's func
+// running synchronously inside call(): it must run only when the returned
+// action is invoked, the same way a Do callback is deferred, so a caller
+// can run action after releasing a lock without DoAndReturn's func having
+// already executed under it.
+func TestDoAndReturnIsDeferredToAction(t *testing.T) {
+	var ran bool
+	c := newAddCall(t)
+	c.DoAndReturn(func(n int) int {
+		ran = true
+		return n + 1
+	})
+
+	_, action := c.call([]interface{}{41})
+	if ran {
+		t.Fatalf("DoAndReturn func ran before action was invoked")
+	}
+	if action == nil {
+		t.Fatalf("call did not return an action for a DoAndReturn expectation")
+	}
+	rets := action()
+	if !ran {
+		t.Fatalf("DoAndReturn func did not run when action was invoked")
+	}
+	if len(rets) != 1 || rets[0] != 42 {
+		t.Fatalf("action returned %v, want [42]", rets)
+	}
+}
+
+// TestCallStaticRetsWithoutAction covers the common case of an expectation
+// with no Do/DoAndReturn: call must return the configured rets directly,
+// with no action to invoke.
+func TestCallStaticRetsWithoutAction(t *testing.T) {
+	c := newAddCall(t)
+	c.Return(7)
+
+	rets, action := c.call([]interface{}{1})
+	if action != nil {
+		t.Fatalf("call returned a non-nil action for an expectation with no Do/DoAndReturn")
+	}
+	if len(rets) != 1 || rets[0] != 7 {
+		t.Fatalf("call returned %v, want [7]", rets)
+	}
+}
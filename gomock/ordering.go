@@ -0,0 +1,197 @@
+// Copyright 2010 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomock
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// prereqNode is a node in a Call's prerequisite expression tree. After
+// builds up a plain AND chain; AnyOrder and OneOf build richer AND/XOR
+// trees that compose with it.
+type prereqNode interface {
+	// satisfied reports whether this node's condition currently holds.
+	satisfied() bool
+	// calls returns every *Call directly reachable from this node, for
+	// loop detection and dropPrereqs.
+	calls() []*Call
+	String() string
+}
+
+// callNode is a leaf of a prerequisite expression tree: it is satisfied
+// once the wrapped Call is.
+type callNode struct{ call *Call }
+
+func (n callNode) satisfied() bool { return n.call.satisfied() }
+func (n callNode) calls() []*Call  { return []*Call{n.call} }
+func (n callNode) String() string  { return n.call.String() }
+
+// andNode is satisfied once every child node is.
+type andNode []prereqNode
+
+func (n andNode) satisfied() bool {
+	for _, child := range n {
+		if !child.satisfied() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n andNode) calls() []*Call {
+	var all []*Call
+	for _, child := range n {
+		all = append(all, child.calls()...)
+	}
+	return all
+}
+
+func (n andNode) String() string { return joinNodes(n, " and ") }
+
+// orNode is satisfied once at least one child node is.
+type orNode []prereqNode
+
+func (n orNode) satisfied() bool {
+	for _, child := range n {
+		if child.satisfied() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n orNode) calls() []*Call {
+	var all []*Call
+	for _, child := range n {
+		all = append(all, child.calls()...)
+	}
+	return all
+}
+
+func (n orNode) String() string { return joinNodes(n, " or ") }
+
+// xorNode is satisfied once exactly one child node is.
+type xorNode []prereqNode
+
+func (n xorNode) satisfied() bool {
+	count := 0
+	for _, child := range n {
+		if child.satisfied() {
+			count++
+		}
+	}
+	return count == 1
+}
+
+func (n xorNode) calls() []*Call {
+	var all []*Call
+	for _, child := range n {
+		all = append(all, child.calls()...)
+	}
+	return all
+}
+
+func (n xorNode) String() string { return joinNodes(n, " xor ") }
+
+func joinNodes(nodes []prereqNode, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// andOf folds extra into existing, flattening into a single andNode rather
+// than nesting one whenever possible.
+func andOf(existing prereqNode, extra prereqNode) prereqNode {
+	if existing == nil {
+		return extra
+	}
+	if and, ok := existing.(andNode); ok {
+		return append(and, extra)
+	}
+	return andNode{existing, extra}
+}
+
+// conditionCall returns a synthetic *Call whose only purpose is to stand in
+// for cond wherever a *Call is expected, e.g. as the argument to After. It
+// is never matched against real invocations. origin identifies where the
+// composite (AnyOrder, OneOf, ...) was built, for error messages and
+// recording.
+func conditionCall(calls []*Call, cond prereqNode, origin string) *Call {
+	var t TestReporter
+	if len(calls) > 0 {
+		t = calls[0].t
+	}
+	return &Call{t: t, cond: cond, origin: origin}
+}
+
+// AnyOrder declares that every one of calls must occur, in any order
+// relative to each other, before whatever the returned *Call is used as a
+// prerequisite for:
+//
+//	post.After(gomock.AnyOrder(a, b, c))
+func AnyOrder(calls ...*Call) *Call {
+	nodes := make(andNode, len(calls))
+	for i, call := range calls {
+		nodes[i] = callNode{call}
+	}
+	return conditionCall(calls, nodes, callerInfo(1))
+}
+
+// OneOf declares that exactly one of calls must match. The returned *Call
+// is a composite that can itself be used as a prerequisite via After.
+func OneOf(calls ...*Call) *Call {
+	nodes := make(xorNode, len(calls))
+	for i, call := range calls {
+		nodes[i] = callNode{call}
+	}
+	return conditionCall(calls, nodes, callerInfo(1))
+}
+
+// callerInfo formats the file and line of the caller skip frames above
+// this one, for use as a Call's origin.
+func callerInfo(skip int) string {
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		return fmt.Sprintf("%s:%d", file, line)
+	}
+	return "unknown file"
+}
+
+// CallSequence is a named, independent chain of calls built up with Add.
+// Building several Sequences side by side keeps setup readable when test
+// expectations are only partially ordered, instead of threading After
+// calls together by hand.
+type CallSequence struct {
+	name string
+	last *Call
+}
+
+// Sequence starts a new named call sequence.
+func Sequence(name string) *CallSequence {
+	return &CallSequence{name: name}
+}
+
+// Add appends call to the sequence, requiring it to occur after every call
+// previously added to this sequence, and returns call for chaining.
+func (s *CallSequence) Add(call *Call) *Call {
+	if s.last != nil {
+		call.After(s.last)
+	}
+	s.last = call
+	return call
+}
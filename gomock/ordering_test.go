@@ -0,0 +1,112 @@
+// Copyright 2010 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomock
+
+import "testing"
+
+func newOrderingAddCall(t *testing.T) *Call {
+	return &Call{
+		t:          t,
+		receiver:   mockAdder{},
+		method:     "Add",
+		methodType: addMethodType,
+		args:       []Matcher{Any()},
+		minCalls:   1,
+		maxCalls:   1,
+	}
+}
+
+// TestAnyOrderSatisfiedRequiresEveryLeaf checks that an AnyOrder composite
+// is only satisfied once every one of its calls has been made, regardless
+// of which order they happen in.
+func TestAnyOrderSatisfiedRequiresEveryLeaf(t *testing.T) {
+	a, b := newOrderingAddCall(t), newOrderingAddCall(t)
+	any := AnyOrder(a, b)
+
+	if any.satisfied() {
+		t.Fatalf("AnyOrder is satisfied before either call matched")
+	}
+	b.call([]interface{}{1})
+	if any.satisfied() {
+		t.Fatalf("AnyOrder is satisfied after only one of its two calls matched")
+	}
+	a.call([]interface{}{1})
+	if !any.satisfied() {
+		t.Fatalf("AnyOrder is not satisfied after every call matched")
+	}
+}
+
+// TestOneOfSatisfiedRequiresExactlyOne checks that a OneOf composite is
+// satisfied once exactly one of its calls has matched, and no longer once
+// a second one also matches.
+func TestOneOfSatisfiedRequiresExactlyOne(t *testing.T) {
+	a, b := newOrderingAddCall(t), newOrderingAddCall(t)
+	one := OneOf(a, b)
+
+	if one.satisfied() {
+		t.Fatalf("OneOf is satisfied before either call matched")
+	}
+	a.call([]interface{}{1})
+	if !one.satisfied() {
+		t.Fatalf("OneOf is not satisfied after exactly one call matched")
+	}
+	b.call([]interface{}{1})
+	if one.satisfied() {
+		t.Fatalf("OneOf is still satisfied after a second call also matched")
+	}
+}
+
+// TestSequenceOrdersAddedCalls checks that each call added to a Sequence
+// requires every call added before it.
+func TestSequenceOrdersAddedCalls(t *testing.T) {
+	seq := Sequence("s")
+	a := seq.Add(newOrderingAddCall(t))
+	b := seq.Add(newOrderingAddCall(t))
+
+	if !b.isPreReq(a) {
+		t.Fatalf("second call in a Sequence does not depend on the first")
+	}
+	if a.isPreReq(b) {
+		t.Fatalf("first call in a Sequence unexpectedly depends on the second")
+	}
+}
+
+// TestAfterDetectsLoop checks that After refuses to create a direct
+// prerequisite loop between two calls.
+func TestAfterDetectsLoop(t *testing.T) {
+	var failed bool
+	a := newOrderingAddCall(t)
+	a.t = recordingT{&failed}
+	b := newOrderingAddCall(t)
+	b.t = recordingT{&failed}
+
+	b.After(a)
+	a.After(b)
+	if !failed {
+		t.Fatalf("After did not report a failure for a direct prerequisite loop")
+	}
+}
+
+// TestAfterDetectsSelfLoop checks that a call can't be its own prerequisite.
+func TestAfterDetectsSelfLoop(t *testing.T) {
+	var failed bool
+	a := newOrderingAddCall(t)
+	a.t = recordingT{&failed}
+
+	a.After(a)
+	if !failed {
+		t.Fatalf("After did not report a failure for a call that is its own prerequisite")
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2010 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// recordedArg captures one matcher from a Call's setup for replay. When the
+// matcher is a concrete value built with Eq, HasValue is set and Value
+// holds that value, round-tripped through JSON: every number comes back as
+// float64, which ReplayFromJSON converts back to the parameter's numeric
+// type; values of other types keep their JSON-decoded form, so
+// gomock.Eq's reflect.DeepEqual need not match them. Otherwise Desc holds the
+// matcher's rendered String(), and ReplayFromJSON falls back to a matcher
+// registered with RegisterReplayMatcher, or failing that gomock.Eq(Desc),
+// which is unlikely to match anything real.
+type recordedArg struct {
+	HasValue bool        `json:"has_value,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+	Desc     string      `json:"desc,omitempty"`
+}
+
+// recordedPrereq mirrors a prereqNode for JSON. A leaf (Kind == "")
+// references a previously recorded Call by its origin; a composite carries
+// Kind ("and", "or", or "xor") and its child nodes.
+type recordedPrereq struct {
+	Origin string           `json:"origin,omitempty"`
+	Kind   string           `json:"kind,omitempty"`
+	Of     []recordedPrereq `json:"of,omitempty"`
+}
+
+// recordedSetup describes the static expectation a Call was configured
+// with, independent of any invocations made against it. HasRets
+// distinguishes a Call that had Return called on it (even with zero
+// values) from one that didn't, since Rets being empty is ambiguous
+// otherwise; Rets is round-tripped through JSON with the same
+// numeric-coercion caveat as recordedArg.Value.
+type recordedSetup struct {
+	Receiver string          `json:"receiver"`
+	Method   string          `json:"method"`
+	Args     []recordedArg   `json:"args"`
+	MinCalls int             `json:"min_calls"`
+	MaxCalls int             `json:"max_calls"`
+	PreReq   *recordedPrereq `json:"pre_req,omitempty"`
+	HasRets  bool            `json:"has_rets,omitempty"`
+	Rets     []interface{}   `json:"rets,omitempty"`
+	Origin   string          `json:"origin"`
+}
+
+// recordedInvocation describes one actual call matched against a recorded
+// expectation.
+type recordedInvocation struct {
+	Receiver string    `json:"receiver"`
+	Method   string    `json:"method"`
+	Args     []string  `json:"args"`
+	Rets     []string  `json:"rets"`
+	Origin   string    `json:"origin"` // origin of the expectation the call matched
+	Time     time.Time `json:"time"`
+}
+
+// recordEvent is the JSON envelope written to the stream for each event;
+// exactly one of Setup or Invocation is set, according to Type.
+type recordEvent struct {
+	Type       string              `json:"type"` // "setup" or "call"
+	Setup      *recordedSetup      `json:"setup,omitempty"`
+	Invocation *recordedInvocation `json:"invocation,omitempty"`
+}
+
+// Recorder serializes Call setups and the invocations matched against them
+// into a structured JSON stream, one event per line. Attach it to a Call
+// with Call.WithRecorder to capture a production trace of an interface, or
+// to get a machine-readable audit of what a mock did during a test run.
+// The stream produced can be turned back into expectations with
+// ReplayFromJSON.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder returns a Recorder that writes its JSON stream to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// WithRecorder attaches r to c: the call's setup is written immediately,
+// and every subsequent invocation matched against c is written as it
+// happens.
+func (c *Call) WithRecorder(r *Recorder) *Call {
+	c.recorder = r
+	r.recordSetup(c)
+	return c
+}
+
+func (r *Recorder) recordSetup(c *Call) {
+	args := make([]recordedArg, len(c.args))
+	for i, m := range c.args {
+		if e, ok := m.(eqMatcher); ok {
+			args[i] = recordedArg{HasValue: true, Value: e.x}
+		} else {
+			args[i] = recordedArg{Desc: m.String()}
+		}
+	}
+	r.write(recordEvent{
+		Type: "setup",
+		Setup: &recordedSetup{
+			Receiver: fmt.Sprintf("%T", c.receiver),
+			Method:   c.method,
+			Args:     args,
+			MinCalls: c.minCalls,
+			MaxCalls: c.maxCalls,
+			PreReq:   recordPrereqNode(c.preReq),
+			HasRets:  c.rets != nil,
+			Rets:     c.rets,
+			Origin:   c.origin,
+		},
+	})
+}
+
+// recordPrereqNode serializes a prereqNode into its JSON form. A leaf call
+// that is itself an AnyOrder/OneOf composite (identifiable by having a cond
+// of its own) is never independently recorded, so its condition is inlined
+// rather than referenced by origin.
+func recordPrereqNode(node prereqNode) *recordedPrereq {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case callNode:
+		if n.call.cond != nil {
+			return recordPrereqNode(n.call.cond)
+		}
+		return &recordedPrereq{Origin: n.call.origin}
+	case andNode:
+		return &recordedPrereq{Kind: "and", Of: recordPrereqNodes(n)}
+	case orNode:
+		return &recordedPrereq{Kind: "or", Of: recordPrereqNodes(n)}
+	case xorNode:
+		return &recordedPrereq{Kind: "xor", Of: recordPrereqNodes(n)}
+	default:
+		return nil
+	}
+}
+
+func recordPrereqNodes(nodes []prereqNode) []recordedPrereq {
+	out := make([]recordedPrereq, 0, len(nodes))
+	for _, node := range nodes {
+		if rp := recordPrereqNode(node); rp != nil {
+			out = append(out, *rp)
+		}
+	}
+	return out
+}
+
+func (r *Recorder) recordInvocation(c *Call, args, rets []interface{}) {
+	r.write(recordEvent{
+		Type: "call",
+		Invocation: &recordedInvocation{
+			Receiver: fmt.Sprintf("%T", c.receiver),
+			Method:   c.method,
+			Args:     sprintAll(args),
+			Rets:     sprintAll(rets),
+			Origin:   c.origin,
+			Time:     time.Now(),
+		},
+	})
+}
+
+func sprintAll(vs []interface{}) []string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = fmt.Sprintf("%#v", v)
+	}
+	return out
+}
+
+func (r *Recorder) write(e recordEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A broken pipe here would already have surfaced through the test's
+	// own I/O; there's no TestReporter in scope to fail through, so the
+	// write is best-effort.
+	_ = r.enc.Encode(e)
+}
+
+// replayMatchers holds matcher builders registered via
+// RegisterReplayMatcher, keyed by the matcher's exact recorded String().
+var replayMatchers = struct {
+	mu       sync.Mutex
+	builders map[string]func(desc string) Matcher
+}{builders: make(map[string]func(desc string) Matcher)}
+
+// RegisterReplayMatcher teaches ReplayFromJSON how to reconstruct a custom
+// matcher from its recorded String() form. name must be the exact string a
+// matcher of that kind prints via String(); ReplayFromJSON falls back to
+// gomock.Eq(desc) for any argument whose recorded description isn't
+// registered.
+func RegisterReplayMatcher(name string, build func(desc string) Matcher) {
+	replayMatchers.mu.Lock()
+	defer replayMatchers.mu.Unlock()
+	replayMatchers.builders[name] = build
+}
+
+// ReplayFromJSON reads a stream of recorded Call setups written by a
+// Recorder and reconstructs them as expectations against receiver, so a
+// captured trace of production calls can be replayed as a deterministic
+// test. Prerequisite relationships, including AnyOrder/OneOf composites,
+// are restored by matching origins against the Calls already decoded
+// earlier in the stream, so the calls that make up a prerequisite must be
+// recorded before whatever depends on them.
+func ReplayFromJSON(t TestReporter, receiver interface{}, r io.Reader) []*Call {
+	var calls []*Call
+	byOrigin := make(map[string]*Call)
+
+	dec := json.NewDecoder(r)
+	for {
+		var e recordEvent
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("gomock: ReplayFromJSON: decoding recorded call: %v", err)
+			return calls
+		}
+		if e.Type != "setup" || e.Setup == nil {
+			continue
+		}
+
+		call := replayCall(t, receiver, e.Setup)
+		if e.Setup.PreReq != nil {
+			call.preReq = replayPrereqNode(*e.Setup.PreReq, byOrigin)
+		}
+		byOrigin[e.Setup.Origin] = call
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// replayPrereqNode reconstructs a prereqNode from its JSON form, resolving
+// leaf references against calls decoded earlier in the stream.
+func replayPrereqNode(rp recordedPrereq, byOrigin map[string]*Call) prereqNode {
+	if rp.Kind == "" {
+		if call, ok := byOrigin[rp.Origin]; ok {
+			return callNode{call}
+		}
+		return nil
+	}
+	nodes := make([]prereqNode, 0, len(rp.Of))
+	for _, child := range rp.Of {
+		if n := replayPrereqNode(child, byOrigin); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	switch rp.Kind {
+	case "and":
+		return andNode(nodes)
+	case "or":
+		return orNode(nodes)
+	case "xor":
+		return xorNode(nodes)
+	default:
+		return nil
+	}
+}
+
+// coerceRetsToMethodTypes converts JSON-decoded return values back to the
+// method's declared output types where the only mismatch is a numeric
+// kind: every JSON number decodes as float64, so an int return recorded as
+// 42 would otherwise fail Return's stricter assignability check. Anything
+// else is passed through unchanged, for Return itself to validate or
+// reject.
+func coerceRetsToMethodTypes(rets []interface{}, ft reflect.Type) []interface{} {
+	out := make([]interface{}, len(rets))
+	for i, v := range rets {
+		out[i] = v
+		if v == nil || i >= ft.NumOut() {
+			continue
+		}
+		want := ft.Out(i)
+		got := reflect.TypeOf(v)
+		if got.Kind() != want.Kind() && isNumericKind(got.Kind()) && isNumericKind(want.Kind()) && got.ConvertibleTo(want) {
+			out[i] = reflect.ValueOf(v).Convert(want).Interface()
+		}
+	}
+	return out
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func replayCall(t TestReporter, receiver interface{}, rs *recordedSetup) *Call {
+	// The bound method's type leaves out the receiver, the same way the
+	// methodType of a Call built by generated mock code does.
+	method := reflect.ValueOf(receiver).MethodByName(rs.Method)
+	if !method.IsValid() {
+		t.Fatalf("gomock: ReplayFromJSON: %T has no method %q", receiver, rs.Method)
+		return nil
+	}
+	mt := method.Type()
+
+	args := make([]Matcher, len(rs.Args))
+	for i, a := range rs.Args {
+		switch {
+		case a.HasValue:
+			v := a.Value
+			if v != nil && i < mt.NumIn() && !(mt.IsVariadic() && i >= mt.NumIn()-1) {
+				got, want := reflect.TypeOf(v), mt.In(i)
+				if got.Kind() != want.Kind() && isNumericKind(got.Kind()) && isNumericKind(want.Kind()) {
+					v = reflect.ValueOf(v).Convert(want).Interface()
+				}
+			}
+			args[i] = Eq(v)
+		default:
+			replayMatchers.mu.Lock()
+			build, ok := replayMatchers.builders[a.Desc]
+			replayMatchers.mu.Unlock()
+			if ok {
+				args[i] = build(a.Desc)
+			} else {
+				args[i] = Eq(a.Desc)
+			}
+		}
+	}
+
+	call := &Call{
+		t:          t,
+		receiver:   receiver,
+		method:     rs.Method,
+		methodType: mt,
+		args:       args,
+		minCalls:   rs.MinCalls,
+		maxCalls:   rs.MaxCalls,
+		origin:     rs.Origin,
+	}
+	if rs.HasRets {
+		call.Return(coerceRetsToMethodTypes(rs.Rets, mt)...)
+	}
+	return call
+}
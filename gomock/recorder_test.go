@@ -0,0 +1,133 @@
+// Copyright 2010 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomock
+
+import (
+	"bytes"
+	"testing"
+)
+
+// mockAdder is a concrete adder implementation, so ReplayFromJSON has a
+// real method to look up by reflection when reconstructing a Call.
+type mockAdder struct{}
+
+func (mockAdder) Add(n int) int { return n }
+
+func newRecorderAddCall(t *testing.T, origin string) *Call {
+	return &Call{
+		t:          t,
+		receiver:   mockAdder{},
+		method:     "Add",
+		methodType: addMethodType,
+		args:       []Matcher{Eq(41)},
+		minCalls:   1,
+		maxCalls:   1,
+		origin:     origin,
+	}
+}
+
+// TestRecordReplayRoundTripsRets guards against a replayed expectation
+// losing its configured Return values: recording a Call with Return(42)
+// and replaying it must produce a Call that still returns 42, not the
+// zero value.
+func TestRecordReplayRoundTripsRets(t *testing.T) {
+	var buf bytes.Buffer
+	c := newRecorderAddCall(t, "a")
+	c.Return(42)
+	c.WithRecorder(NewRecorder(&buf))
+
+	replayed := ReplayFromJSON(t, mockAdder{}, &buf)
+	if len(replayed) != 1 {
+		t.Fatalf("ReplayFromJSON returned %d calls, want 1", len(replayed))
+	}
+
+	rets, action := replayed[0].call([]interface{}{41})
+	if action != nil {
+		t.Fatalf("replayed call unexpectedly returned a non-nil action")
+	}
+	if len(rets) != 1 || rets[0] != 42 {
+		t.Fatalf("replayed call returned %v, want [42]", rets)
+	}
+}
+
+// TestRecordReplayRoundTripsConcreteArg guards against a replayed
+// expectation's Eq matcher reconstructing as Eq(desc) - the matcher's
+// rendered String() - instead of the real recorded value.
+func TestRecordReplayRoundTripsConcreteArg(t *testing.T) {
+	var buf bytes.Buffer
+	c := newRecorderAddCall(t, "a")
+	c.Return(0)
+	c.WithRecorder(NewRecorder(&buf))
+
+	replayed := ReplayFromJSON(t, mockAdder{}, &buf)
+	if len(replayed) != 1 {
+		t.Fatalf("ReplayFromJSON returned %d calls, want 1", len(replayed))
+	}
+	if err := replayed[0].matches([]interface{}{41}); err != nil {
+		t.Fatalf("replayed call did not match its recorded concrete arg: %v", err)
+	}
+	if err := replayed[0].matches([]interface{}{40}); err == nil {
+		t.Fatalf("replayed call matched an arg it wasn't recorded with")
+	}
+}
+
+// TestRecordReplayRoundTripsCompositePrereq guards against an AnyOrder/OneOf
+// composite prerequisite losing its tree structure on the round trip: the
+// replayed dependent call must still require every leaf of the composite
+// to be satisfied, not just whichever leaf happened to be recorded last.
+func TestRecordReplayRoundTripsCompositePrereq(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+
+	c1 := newRecorderAddCall(t, "c1")
+	c1.Return(0)
+	c1.WithRecorder(r)
+	c2 := newRecorderAddCall(t, "c2")
+	c2.Return(0)
+	c2.WithRecorder(r)
+
+	post := newRecorderAddCall(t, "post")
+	post.Return(0)
+	post.After(AnyOrder(c1, c2))
+	post.WithRecorder(r)
+
+	replayed := ReplayFromJSON(t, mockAdder{}, &buf)
+	var replayedPost *Call
+	for _, c := range replayed {
+		if c.origin == "post" {
+			replayedPost = c
+		}
+	}
+	if replayedPost == nil {
+		t.Fatalf("ReplayFromJSON did not return the composite-dependent call")
+	}
+	if replayedPost.preReq.satisfied() {
+		t.Fatalf("replayed prerequisite is satisfied before either leaf matched")
+	}
+
+	var replayedC1 *Call
+	for _, c := range replayed {
+		if c.origin == "c1" {
+			replayedC1 = c
+		}
+	}
+	if replayedC1 == nil {
+		t.Fatalf("ReplayFromJSON did not return the c1 leaf call")
+	}
+	replayedC1.call([]interface{}{41})
+	if replayedPost.preReq.satisfied() {
+		t.Fatalf("replayed prerequisite is satisfied after only one of its two leaves matched")
+	}
+}